@@ -0,0 +1,213 @@
+// Package gen is a pluggable code-generation subsystem for pbparser,
+// modeled on govpp's binapigen.Plugin and protoc-gen-go's Generator:
+// callers register one or more Plugins, hand Run a set of parsed
+// ProtoFiles, and each plugin receives every file -- already verified and
+// linked, in dependency order -- to emit whatever output it likes.
+package gen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gingerbus/pbparser"
+)
+
+// GenFile is a single file a Plugin wants written out.
+type GenFile struct {
+	Name    string
+	Content []byte
+}
+
+// GenRequest is handed to a Plugin for each file it generates against. It
+// exposes the fully-linked ProtoFile (so Oracles is already populated) and
+// helpers for resolving a NamedDataType reference back to the
+// MessageElement/EnumElement it points to, mirroring the lookup verify
+// does internally.
+type GenRequest struct {
+	File *pbparser.ProtoFile
+}
+
+// ResolveMessage looks up the MessageElement a (possibly leading-dot,
+// fully-qualified) NamedDataType reference points to, searching the
+// request's file and its direct dependencies (the entries of File.Oracles);
+// files imported only by those dependencies are not searched.
+func (r *GenRequest) ResolveMessage(dt pbparser.NamedDataType) (*pbparser.MessageElement, bool) {
+	name := strings.TrimPrefix(dt.Name(), ".")
+	for _, orcl := range r.File.Oracles {
+		if m, ok := findMessage(name, orcl.ProtoFile().Messages); ok {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// ResolveEnum looks up the EnumElement a (possibly leading-dot,
+// fully-qualified) NamedDataType reference points to, the same way
+// ResolveMessage does for messages.
+func (r *GenRequest) ResolveEnum(dt pbparser.NamedDataType) (*pbparser.EnumElement, bool) {
+	name := strings.TrimPrefix(dt.Name(), ".")
+	for _, orcl := range r.File.Oracles {
+		if e, ok := findEnum(name, orcl.ProtoFile().Messages, orcl.ProtoFile().Enums); ok {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+func findMessage(qualifiedName string, msgs []pbparser.MessageElement) (*pbparser.MessageElement, bool) {
+	for i := range msgs {
+		if msgs[i].QualifiedName == qualifiedName {
+			return &msgs[i], true
+		}
+		if m, ok := findMessage(qualifiedName, msgs[i].Messages); ok {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+func findEnum(qualifiedName string, msgs []pbparser.MessageElement, enums []pbparser.EnumElement) (*pbparser.EnumElement, bool) {
+	for i := range enums {
+		if enums[i].QualifiedName == qualifiedName {
+			return &enums[i], true
+		}
+	}
+	for i := range msgs {
+		if e, ok := findEnum(qualifiedName, msgs[i].Messages, msgs[i].Enums); ok {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// Plugin is a single code generator. Name identifies the plugin in error
+// messages; Generate receives a verified, linked file and returns the
+// files it wants written.
+type Plugin interface {
+	Name() string
+	Generate(*GenRequest) ([]GenFile, error)
+}
+
+// Registry holds the set of Plugins a Run call dispatches to.
+type Registry struct {
+	plugins []Plugin
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds p to the registry. Plugins run in registration order.
+func (r *Registry) Register(p Plugin) {
+	r.plugins = append(r.plugins, p)
+}
+
+// Options configures a Run call.
+type Options struct {
+	// ImportProvider resolves a file's import statements during
+	// verification; required if any file in the Run has dependencies.
+	ImportProvider pbparser.ImportModuleProvider
+	// Output receives every file a plugin generates, in dependency order.
+	// It is the caller's responsibility to write it out (to disk, to a
+	// buffer, wherever); Run itself never touches the filesystem.
+	Output func(GenFile) error
+}
+
+// Run verifies every file in files, orders them topologically by
+// dependency, and dispatches each one in turn to every plugin registered
+// with registry.
+func Run(files []*pbparser.ProtoFile, registry *Registry, opts Options) error {
+	for _, pf := range files {
+		if err := pbparser.Verify(pf, opts.ImportProvider); err != nil {
+			return fmt.Errorf("gen: verifying package %s: %w", pf.PackageName, err)
+		}
+	}
+
+	ordered, err := topoSort(files)
+	if err != nil {
+		return err
+	}
+
+	for _, pf := range ordered {
+		req := &GenRequest{File: pf}
+		for _, p := range registry.plugins {
+			genFiles, err := p.Generate(req)
+			if err != nil {
+				return fmt.Errorf("gen: plugin %s on package %s: %w", p.Name(), pf.PackageName, err)
+			}
+			for _, gf := range genFiles {
+				if opts.Output != nil {
+					if err := opts.Output(gf); err != nil {
+						return fmt.Errorf("gen: writing %s: %w", gf.Name, err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// topoSort orders files so that a file always comes after every dependency
+// package also present in files, using each file's linked Oracles (built by
+// Verify) as the dependency edges.
+func topoSort(files []*pbparser.ProtoFile) ([]*pbparser.ProtoFile, error) {
+	byPkg := make(map[string]*pbparser.ProtoFile, len(files))
+	for _, pf := range files {
+		byPkg[pf.PackageName] = pf
+	}
+
+	deps := make(map[string][]string, len(files))
+	for _, pf := range files {
+		for pkg := range pf.Oracles {
+			if pkg == pf.PackageName {
+				continue
+			}
+			if _, known := byPkg[pkg]; known {
+				deps[pf.PackageName] = append(deps[pf.PackageName], pkg)
+			}
+		}
+	}
+
+	var ordered []*pbparser.ProtoFile
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(files))
+
+	var visit func(pkg string) error
+	visit = func(pkg string) error {
+		switch state[pkg] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("gen: dependency cycle detected at package %s", pkg)
+		}
+		state[pkg] = visiting
+		depPkgs := append([]string{}, deps[pkg]...)
+		sort.Strings(depPkgs)
+		for _, d := range depPkgs {
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		state[pkg] = visited
+		ordered = append(ordered, byPkg[pkg])
+		return nil
+	}
+
+	pkgs := make([]string, 0, len(files))
+	for _, pf := range files {
+		pkgs = append(pkgs, pf.PackageName)
+	}
+	sort.Strings(pkgs)
+	for _, pkg := range pkgs {
+		if err := visit(pkg); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
@@ -0,0 +1,176 @@
+// Package gostruct is a reference pbparser/gen.Plugin that emits a plain Go
+// struct, with `protobuf` tags, for every message in a file -- the data
+// shape protoc-gen-go produces, minus the wire-format machinery, for
+// callers that only need the struct layout (e.g. JSON-based services).
+package gostruct
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/gingerbus/pbparser"
+	"github.com/gingerbus/pbparser/gen"
+)
+
+// Plugin generates one <package>.pb.go file per ProtoFile that declares
+// at least one message.
+type Plugin struct{}
+
+// New returns a ready-to-register Plugin.
+func New() *Plugin {
+	return &Plugin{}
+}
+
+// Name implements gen.Plugin.
+func (p *Plugin) Name() string {
+	return "gostruct"
+}
+
+// Generate implements gen.Plugin.
+func (p *Plugin) Generate(req *gen.GenRequest) ([]gen.GenFile, error) {
+	if len(req.File.Messages) == 0 {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprint(&buf, "// Code generated by pbparser/gen/gostruct. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", goPackageName(req.File.PackageName))
+
+	for _, msg := range req.File.Messages {
+		writeStruct(&buf, msg)
+	}
+
+	return []gen.GenFile{{
+		Name:    req.File.PackageName + ".pb.go",
+		Content: buf.Bytes(),
+	}}, nil
+}
+
+func writeStruct(buf *bytes.Buffer, msg pbparser.MessageElement) {
+	fmt.Fprintf(buf, "type %s struct {\n", goTypeName(msg.QualifiedName))
+	for _, f := range msg.Fields {
+		writeField(buf, f)
+	}
+	for _, oneof := range msg.OneOfs {
+		for _, f := range oneof.Fields {
+			writeField(buf, f)
+		}
+	}
+	fmt.Fprint(buf, "}\n\n")
+
+	for _, nested := range msg.Messages {
+		writeStruct(buf, nested)
+	}
+}
+
+func writeField(buf *bytes.Buffer, f pbparser.FieldElement) {
+	fmt.Fprintf(buf, "\t%s %s `protobuf:\"%s,%d,opt,name=%s\" json:\"%s,omitempty\"`\n",
+		exportedName(f.Name), goType(f), wireType(f), f.Tag, f.Name, f.Name)
+}
+
+func goPackageName(pkg string) string {
+	return strings.ReplaceAll(pkg, ".", "")
+}
+
+// goTypeName derives the Go identifier protoc-gen-go would generate for a
+// fully-qualified message/enum name: the package prefix is dropped and any
+// remaining nesting is flattened with underscores, e.g.
+// ".foo.bar.Outer.Inner" -> "Outer_Inner".
+func goTypeName(qualifiedName string) string {
+	name := strings.TrimPrefix(qualifiedName, ".")
+	var typeParts []string
+	for _, part := range strings.Split(name, ".") {
+		if part != "" && part[0] >= 'A' && part[0] <= 'Z' {
+			typeParts = append(typeParts, part)
+		}
+	}
+	return strings.Join(typeParts, "_")
+}
+
+// exportedName converts a snake_case field name to the PascalCase Go
+// field name protoc-gen-go would generate for it.
+func exportedName(name string) string {
+	var b []byte
+	upperNext := true
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '_' {
+			upperNext = true
+			continue
+		}
+		if upperNext && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upperNext = false
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+func goType(f pbparser.FieldElement) string {
+	base := baseGoType(f)
+	if f.Label == "repeated" {
+		return "[]" + base
+	}
+	return base
+}
+
+func baseGoType(f pbparser.FieldElement) string {
+	switch f.Type.Category() {
+	case pbparser.ScalarDataTypeCategory:
+		if t, ok := scalarGoTypes[f.Type.Name()]; ok {
+			return t
+		}
+		return "interface{}"
+	case pbparser.NamedDataTypeCategory:
+		return "*" + goTypeName(f.Type.Name())
+	case pbparser.EnumDataTypeCategory:
+		return goTypeName(f.Type.Name())
+	case pbparser.MapDataTypeCategory:
+		// every map field is emitted as map[string]string, whatever its
+		// declared key and value types
+		return "map[string]string"
+	default:
+		return "interface{}"
+	}
+}
+
+var scalarGoTypes = map[string]string{
+	"double":   "float64",
+	"float":    "float32",
+	"int32":    "int32",
+	"int64":    "int64",
+	"uint32":   "uint32",
+	"uint64":   "uint64",
+	"sint32":   "int32",
+	"sint64":   "int64",
+	"fixed32":  "uint32",
+	"fixed64":  "uint64",
+	"sfixed32": "int32",
+	"sfixed64": "int64",
+	"bool":     "bool",
+	"string":   "string",
+	"bytes":    "[]byte",
+}
+
+// wireType returns the wire-type token protoc-gen-go puts first in a
+// `protobuf:"..."` struct tag.
+func wireType(f pbparser.FieldElement) string {
+	switch f.Type.Category() {
+	case pbparser.NamedDataTypeCategory, pbparser.MapDataTypeCategory:
+		return "bytes"
+	case pbparser.EnumDataTypeCategory:
+		return "varint"
+	}
+	switch f.Type.Name() {
+	case "string", "bytes":
+		return "bytes"
+	case "double", "fixed64", "sfixed64":
+		return "fixed64"
+	case "float", "fixed32", "sfixed32":
+		return "fixed32"
+	default:
+		return "varint"
+	}
+}
@@ -0,0 +1,99 @@
+// Package resthandler is a reference pbparser/gen.Plugin that turns each
+// service/rpc into a Gorilla-style mux registration, mirroring govpp
+// binapigen's optional HTTP-handler generation: every RPC becomes a
+// POST /<package>.<Service>/<RPC> route whose JSON body is decoded into
+// the RPC's request type and whose response is marshaled back as JSON.
+package resthandler
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/gingerbus/pbparser"
+	"github.com/gingerbus/pbparser/gen"
+)
+
+// Plugin generates one <package>.http.go file per ProtoFile that declares
+// at least one service.
+type Plugin struct{}
+
+// New returns a ready-to-register Plugin.
+func New() *Plugin {
+	return &Plugin{}
+}
+
+// Name implements gen.Plugin.
+func (p *Plugin) Name() string {
+	return "resthandler"
+}
+
+// Generate implements gen.Plugin.
+func (p *Plugin) Generate(req *gen.GenRequest) ([]gen.GenFile, error) {
+	if len(req.File.Services) == 0 {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprint(&buf, "// Code generated by pbparser/gen/resthandler. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", goPackageName(req.File.PackageName))
+	fmt.Fprint(&buf, "import (\n\t\"encoding/json\"\n\t\"net/http\"\n\n\t\"github.com/gorilla/mux\"\n)\n\n")
+
+	for _, svc := range req.File.Services {
+		writeHandlerInterface(&buf, svc)
+		writeRegisterFunc(&buf, req.File.PackageName, svc)
+	}
+
+	return []gen.GenFile{{
+		Name:    req.File.PackageName + ".http.go",
+		Content: buf.Bytes(),
+	}}, nil
+}
+
+func writeHandlerInterface(buf *bytes.Buffer, svc pbparser.ServiceElement) {
+	fmt.Fprintf(buf, "// %sHandler implements the business logic behind each %s RPC.\n", svc.Name, svc.Name)
+	fmt.Fprintf(buf, "type %sHandler interface {\n", svc.Name)
+	for _, rpc := range svc.RPCs {
+		fmt.Fprintf(buf, "\t%s(*%s) (*%s, error)\n",
+			rpc.Name, goTypeName(rpc.RequestType.Name()), goTypeName(rpc.ResponseType.Name()))
+	}
+	fmt.Fprint(buf, "}\n\n")
+}
+
+func writeRegisterFunc(buf *bytes.Buffer, pkg string, svc pbparser.ServiceElement) {
+	fmt.Fprintf(buf, "// Register%sRoutes wires every %s RPC onto r as a JSON-over-HTTP POST route.\n", svc.Name, svc.Name)
+	fmt.Fprintf(buf, "func Register%sRoutes(r *mux.Router, h %sHandler) {\n", svc.Name, svc.Name)
+	for _, rpc := range svc.RPCs {
+		reqType := goTypeName(rpc.RequestType.Name())
+		fmt.Fprintf(buf, "\tr.HandleFunc(\"/%s.%s/%s\", func(w http.ResponseWriter, req *http.Request) {\n",
+			pkg, svc.Name, rpc.Name)
+		fmt.Fprintf(buf, "\t\tvar in %s\n", reqType)
+		fmt.Fprint(buf, "\t\tif err := json.NewDecoder(req.Body).Decode(&in); err != nil {\n")
+		fmt.Fprint(buf, "\t\t\thttp.Error(w, err.Error(), http.StatusBadRequest)\n\t\t\treturn\n\t\t}\n\n")
+		fmt.Fprintf(buf, "\t\tout, err := h.%s(&in)\n", rpc.Name)
+		fmt.Fprint(buf, "\t\tif err != nil {\n\t\t\thttp.Error(w, err.Error(), http.StatusInternalServerError)\n\t\t\treturn\n\t\t}\n\n")
+		fmt.Fprint(buf, "\t\tw.Header().Set(\"Content-Type\", \"application/json\")\n")
+		fmt.Fprint(buf, "\t\tjson.NewEncoder(w).Encode(out)\n")
+		fmt.Fprint(buf, "\t}).Methods(http.MethodPost)\n\n")
+	}
+	fmt.Fprint(buf, "}\n\n")
+}
+
+func goPackageName(pkg string) string {
+	return strings.ReplaceAll(pkg, ".", "")
+}
+
+// goTypeName derives the Go identifier protoc-gen-go would generate for a
+// fully-qualified message name: the package prefix is dropped and any
+// remaining nesting is flattened with underscores, e.g.
+// ".foo.bar.Outer.Inner" -> "Outer_Inner".
+func goTypeName(qualifiedName string) string {
+	name := strings.TrimPrefix(qualifiedName, ".")
+	var typeParts []string
+	for _, part := range strings.Split(name, ".") {
+		if part != "" && part[0] >= 'A' && part[0] <= 'Z' {
+			typeParts = append(typeParts, part)
+		}
+	}
+	return strings.Join(typeParts, "_")
+}
@@ -0,0 +1,147 @@
+// Package linker implements protobuf's scoped symbol resolution, the same
+// two-phase scheme protoc and protoparse use: first every message, enum and
+// extension field across a file and its dependencies is inserted into a
+// single descriptorPool keyed by fully-qualified name, then
+// every type reference is resolved by walking outward from the scope it was
+// declared in.
+//
+// The package intentionally knows nothing about pbparser's own types, so
+// that pbparser can depend on linker without creating an import cycle;
+// callers are responsible for feeding it fully-qualified names and
+// interpreting the resolved Symbol.
+package linker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SymbolKind identifies what kind of declaration a Symbol refers to.
+type SymbolKind int
+
+const (
+	// MessageSymbol marks a symbol that resolved to a message type.
+	MessageSymbol SymbolKind = iota
+	// EnumSymbol marks a symbol that resolved to an enum type.
+	EnumSymbol
+	// ExtensionSymbol marks a symbol that resolved to a field declared
+	// inside an `extend` block, e.g. a custom option.
+	ExtensionSymbol
+)
+
+// Symbol is a single entry in the descriptorPool.
+type Symbol struct {
+	Kind SymbolKind
+	// FullyQualifiedName is the canonical, leading-dot name of the symbol,
+	// e.g. ".foo.bar.Baz".
+	FullyQualifiedName string
+	// Data carries caller-defined auxiliary information about the symbol,
+	// e.g. an ExtensionSymbol stores the name of the message it extends and
+	// its FieldElement here so option resolution doesn't need a second pool.
+	Data interface{}
+}
+
+// Pool is the descriptorPool: every message, enum and extension field
+// declared across a main file and its dependencies, keyed by
+// fully-qualified name. Plain fields, services and RPCs have no SymbolKind
+// and are not held in the pool.
+type Pool struct {
+	mainPackage string
+	symbols     map[string]Symbol
+	packages    []string
+	pkgSeen     map[string]bool
+}
+
+// NewPool creates an empty descriptorPool for the file whose package is
+// mainPackage.
+func NewPool(mainPackage string) *Pool {
+	return &Pool{
+		mainPackage: mainPackage,
+		symbols:     make(map[string]Symbol),
+		pkgSeen:     make(map[string]bool),
+	}
+}
+
+// RegisterPackage records that pkg is a package known to this pool (either
+// the main package or one of its dependencies' packages). It is used later
+// to answer Packages queries.
+func (p *Pool) RegisterPackage(pkg string) {
+	if pkg == p.mainPackage || p.pkgSeen[pkg] {
+		return
+	}
+	p.pkgSeen[pkg] = true
+	p.packages = append(p.packages, pkg)
+}
+
+// Packages returns the dependency package names registered with this pool,
+// i.e. every known package other than the main one.
+func (p *Pool) Packages() []string {
+	return p.packages
+}
+
+// Insert adds a declaration to the pool under its fully-qualified name
+// (without a leading dot, e.g. "foo.bar.Baz"), optionally carrying an
+// auxiliary data value (see Symbol.Data). It returns an error if a symbol
+// with that name was already inserted, mirroring protoc's "already
+// defined" diagnostic.
+func (p *Pool) Insert(qualifiedName string, kind SymbolKind, data ...interface{}) error {
+	key := "." + qualifiedName
+	if existing, found := p.symbols[key]; found {
+		return fmt.Errorf("duplicate symbol %s: already defined as %s", key, existing.kindString())
+	}
+	var d interface{}
+	if len(data) > 0 {
+		d = data[0]
+	}
+	p.symbols[key] = Symbol{Kind: kind, FullyQualifiedName: key, Data: d}
+	return nil
+}
+
+func (s Symbol) kindString() string {
+	switch s.Kind {
+	case EnumSymbol:
+		return "an enum"
+	case ExtensionSymbol:
+		return "an extension"
+	default:
+		return "a message"
+	}
+}
+
+// Resolve implements protobuf's scoped name resolution rules. Given the
+// scope a reference appears in (the fully-qualified name, without leading
+// dot, of the message/file it was declared in) and the referenced type
+// name, it walks outward from scope -> scope's parent -> ... -> root,
+// trying "<enclosing scope>.<name>" at each step, exactly as protoc's
+// DescriptorPool::LookupSymbol does. A leading-dot name is already fully
+// qualified and is looked up directly, with no scope walk.
+func (p *Pool) Resolve(scope, name string) (Symbol, bool) {
+	if strings.HasPrefix(name, ".") {
+		sym, ok := p.symbols[name]
+		return sym, ok
+	}
+	for _, enclosing := range enclosingScopes(scope) {
+		key := "." + name
+		if enclosing != "" {
+			key = "." + enclosing + "." + name
+		}
+		if sym, ok := p.symbols[key]; ok {
+			return sym, true
+		}
+	}
+	return Symbol{}, false
+}
+
+// enclosingScopes returns scope, its parent, its parent's parent, and so on
+// down to "" (the root), in that order.
+func enclosingScopes(scope string) []string {
+	if scope == "" {
+		return []string{""}
+	}
+	parts := strings.Split(scope, ".")
+	scopes := make([]string, 0, len(parts)+1)
+	for i := len(parts); i >= 0; i-- {
+		scopes = append(scopes, strings.Join(parts[:i], "."))
+	}
+	return scopes
+}
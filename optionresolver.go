@@ -0,0 +1,286 @@
+package pbparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gingerbus/pbparser/linker"
+)
+
+// optionContext identifies which well-known google.protobuf.*Options
+// message a given option location extends, so a custom option's extend
+// declaration can be checked against the right extendee.
+type optionContext string
+
+const (
+	fileOptionContext      optionContext = "google.protobuf.FileOptions"
+	messageOptionContext   optionContext = "google.protobuf.MessageOptions"
+	fieldOptionContext     optionContext = "google.protobuf.FieldOptions"
+	oneofOptionContext     optionContext = "google.protobuf.OneofOptions"
+	enumOptionContext      optionContext = "google.protobuf.EnumOptions"
+	enumValueOptionContext optionContext = "google.protobuf.EnumValueOptions"
+	serviceOptionContext   optionContext = "google.protobuf.ServiceOptions"
+	methodOptionContext    optionContext = "google.protobuf.MethodOptions"
+)
+
+// extensionInfo is the auxiliary data a linker.ExtensionSymbol carries: the
+// message the field extends, and the field declaration itself, which gives
+// option resolution both the context to check and the type to parse the
+// option's value as.
+type extensionInfo struct {
+	extendee string
+	field    FieldElement
+}
+
+// insertExtensions adds every field declared inside the `extend` blocks of
+// a file (one belonging to package pkg) to the pool -- both the file-level
+// blocks and the ones nested inside a message -- keyed by its own
+// fully-qualified name (the declaring scope, pkg or a message's
+// QualifiedName, + "." + field name), so that a custom option referencing
+// it from anywhere in the dependency graph can be resolved the same way a
+// message or enum reference is.
+func insertExtensions(pool *linker.Pool, pkg string, pf *ProtoFile) error {
+	if err := insertExtensionFields(pool, pkg, pf.ExtendDeclarations); err != nil {
+		return err
+	}
+	return insertMessageExtensions(pool, pf.Messages)
+}
+
+// insertMessageExtensions recurses into msgs, adding the fields declared in
+// each message's own (possibly further-nested) `extend` blocks, scoped by
+// that message's fully-qualified name.
+func insertMessageExtensions(pool *linker.Pool, msgs []MessageElement) error {
+	for _, msg := range msgs {
+		if err := insertExtensionFields(pool, msg.QualifiedName, msg.ExtendDeclarations); err != nil {
+			return err
+		}
+		if err := insertMessageExtensions(pool, msg.Messages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertExtensionFields(pool *linker.Pool, scope string, extends []ExtendDeclaration) error {
+	for _, ext := range extends {
+		for _, f := range ext.Fields {
+			qualifiedName := scope + "." + f.Name
+			if err := pool.Insert(qualifiedName, linker.ExtensionSymbol, extensionInfo{extendee: ext.Name, field: f}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveOptions walks every option written in pf -- on the file itself,
+// and on every message, field, oneof, enum, enum value, service and method
+// it declares -- and resolves the ones that name a custom option (a
+// parenthesized, dotted extension field reference) against the pool.
+func resolveOptions(pf *ProtoFile, pool *linker.Pool) error {
+	if err := resolveOptionsAt(pool, pf.PackageName, pf.Options, fileOptionContext); err != nil {
+		return err
+	}
+
+	for i := range pf.Messages {
+		if err := resolveMessageOptions(pool, pf.PackageName, &pf.Messages[i]); err != nil {
+			return err
+		}
+	}
+
+	for i := range pf.Enums {
+		if err := resolveEnumOptions(pool, pf.PackageName, &pf.Enums[i]); err != nil {
+			return err
+		}
+	}
+
+	for _, svc := range pf.Services {
+		if err := resolveOptionsAt(pool, pf.PackageName, svc.Options, serviceOptionContext); err != nil {
+			return err
+		}
+		for _, rpc := range svc.RPCs {
+			if err := resolveOptionsAt(pool, pf.PackageName, rpc.Options, methodOptionContext); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func resolveMessageOptions(pool *linker.Pool, scope string, msg *MessageElement) error {
+	// options inside a message resolve from the message's own scope, the
+	// same scope its field type references are resolved from
+	scope = msg.QualifiedName
+	if err := resolveOptionsAt(pool, scope, msg.Options, messageOptionContext); err != nil {
+		return err
+	}
+	for i := range msg.Fields {
+		if err := resolveOptionsAt(pool, scope, msg.Fields[i].Options, fieldOptionContext); err != nil {
+			return err
+		}
+	}
+	for i := range msg.OneOfs {
+		if err := resolveOptionsAt(pool, scope, msg.OneOfs[i].Options, oneofOptionContext); err != nil {
+			return err
+		}
+		for j := range msg.OneOfs[i].Fields {
+			if err := resolveOptionsAt(pool, scope, msg.OneOfs[i].Fields[j].Options, fieldOptionContext); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range msg.Enums {
+		if err := resolveEnumOptions(pool, scope, &msg.Enums[i]); err != nil {
+			return err
+		}
+	}
+	for i := range msg.Messages {
+		if err := resolveMessageOptions(pool, scope, &msg.Messages[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func resolveEnumOptions(pool *linker.Pool, scope string, en *EnumElement) error {
+	if err := resolveOptionsAt(pool, scope, en.Options, enumOptionContext); err != nil {
+		return err
+	}
+	for i := range en.EnumConstants {
+		if err := resolveOptionsAt(pool, scope, en.EnumConstants[i].Options, enumValueOptionContext); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveOptionsAt resolves every custom option in opts, in place. opts and
+// its caller share the same backing array, so writes through the slice
+// index are visible on the original MessageElement/FieldElement/etc.
+// Options that aren't a parenthesized extension reference (the usual
+// `option java_package = "...";` form) are left untouched.
+func resolveOptionsAt(pool *linker.Pool, scope string, opts []OptionElement, want optionContext) error {
+	for i := range opts {
+		name, ok := customOptionName(opts[i].Name)
+		if !ok {
+			continue
+		}
+
+		sym, found := pool.Resolve(scope, name)
+		if !found || sym.Kind != linker.ExtensionSymbol {
+			return fmt.Errorf("option (%s) does not resolve to a known extension", name)
+		}
+		info, ok := sym.Data.(extensionInfo)
+		if !ok {
+			return fmt.Errorf("option (%s): internal error: extension symbol missing its field data", name)
+		}
+		if info.extendee != string(want) {
+			return fmt.Errorf("option (%s) extends %s, but is used where %s is expected",
+				name, info.extendee, want)
+		}
+
+		value, err := parseOptionValue(opts[i].Value, info.field.Type)
+		if err != nil {
+			return fmt.Errorf("option (%s): %w", name, err)
+		}
+
+		opts[i].Extension = &info.field
+		opts[i].ResolvedValue = value
+	}
+	return nil
+}
+
+// customOptionName reports whether an option's written name is a
+// parenthesized extension reference, e.g. "(foo.bar.my_opt)", and if so
+// returns the dotted name inside the parens.
+func customOptionName(name string) (string, bool) {
+	if !strings.HasPrefix(name, "(") || !strings.HasSuffix(name, ")") {
+		return "", false
+	}
+	return name[1 : len(name)-1], true
+}
+
+// parseOptionValue parses an option's raw source text according to its
+// extension field's type: scalars become their natural Go type, and
+// message/enum-typed options accept protobuf's text-format message-literal
+// aggregate syntax (`{ k: v, k2: v2 }`), parsed one level deep into a
+// map[string]string of the still-raw sub-values.
+func parseOptionValue(raw string, typ DataType) (interface{}, error) {
+	raw = strings.TrimSpace(raw)
+
+	switch typ.Category() {
+	case ScalarDataTypeCategory:
+		return parseScalarOptionValue(raw, typ.Name())
+	case NamedDataTypeCategory, EnumDataTypeCategory:
+		if strings.HasPrefix(raw, "{") && strings.HasSuffix(raw, "}") {
+			return parseAggregateOptionValue(raw[1 : len(raw)-1])
+		}
+		return strings.Trim(raw, "\""), nil
+	default:
+		return raw, nil
+	}
+}
+
+func parseScalarOptionValue(raw, scalarType string) (interface{}, error) {
+	switch scalarType {
+	case "bool":
+		return raw == "true", nil
+	case "string", "bytes":
+		return strings.Trim(raw, "\""), nil
+	case "double", "float":
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("value %q is not a valid %s", raw, scalarType)
+		}
+		return v, nil
+	default: // int32, int64, uint32, uint64, sint32, sint64, fixed32, fixed64, sfixed32, sfixed64
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("value %q is not a valid %s", raw, scalarType)
+		}
+		return v, nil
+	}
+}
+
+// parseAggregateOptionValue splits a `k: v, k2: v2` aggregate body into its
+// top-level entries. It does not recurse into nested aggregates; a value
+// that is itself a `{ ... }` literal is returned as-is, unparsed.
+func parseAggregateOptionValue(body string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, entry := range splitTopLevel(body) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("malformed aggregate option entry %q", entry)
+		}
+		result[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return result, nil
+}
+
+// splitTopLevel splits s on commas that are not nested inside braces.
+func splitTopLevel(s string) []string {
+	var entries []string
+	depth := 0
+	start := 0
+	for i, c := range s {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				entries = append(entries, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	entries = append(entries, s[start:])
+	return entries
+}
@@ -0,0 +1,580 @@
+// Package protodesc converts a parsed pbparser.ProtoFile into the standard
+// google.golang.org/protobuf descriptor representation, so that downstream
+// tools (dynamic messages, gRPC reflection, buf-style tooling) can consume
+// this parser's output without rewriting a shadow model of their own.
+//
+// Converting a file requires its NamedDataType references to already be
+// fully-qualified, i.e. the file must have been through Parse/verify's
+// linker pass -- see pbparser.Parse.
+package protodesc
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/gingerbus/pbparser"
+)
+
+// ToFileDescriptorProto walks the model produced by pbparser.Parse and
+// emits the equivalent descriptorpb.FileDescriptorProto.
+//
+// The returned Name is a fallback derived from the package, since pf alone
+// doesn't know the import path it was reached by; ToFiles overrides it with
+// the real one for every file but the root so that it matches the Name
+// dependents reference in their Dependency list.
+func ToFileDescriptorProto(pf *pbparser.ProtoFile) (*descriptorpb.FileDescriptorProto, error) {
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:             proto.String(fallbackFileName(pf.PackageName)),
+		Package:          proto.String(pf.PackageName),
+		Syntax:           proto.String(pf.Syntax),
+		Dependency:       append(append([]string{}, pf.Dependencies...), pf.PublicDependencies...),
+		PublicDependency: publicDependencyIndexes(pf),
+	}
+
+	for _, msg := range pf.Messages {
+		dp, err := messageDescriptorProto(msg)
+		if err != nil {
+			return nil, err
+		}
+		fdp.MessageType = append(fdp.MessageType, dp)
+	}
+
+	for _, en := range pf.Enums {
+		ep, err := enumDescriptorProto(en)
+		if err != nil {
+			return nil, err
+		}
+		fdp.EnumType = append(fdp.EnumType, ep)
+	}
+
+	for _, svc := range pf.Services {
+		sp, err := serviceDescriptorProto(svc)
+		if err != nil {
+			return nil, err
+		}
+		fdp.Service = append(fdp.Service, sp)
+	}
+
+	if opts := fileOptions(pf.Options); opts != nil {
+		fdp.Options = opts
+	}
+
+	return fdp, nil
+}
+
+// ToFiles converts main and every (transitive/public) dependency reachable
+// through it into a protoregistry.Files set, ready to hand to
+// protodesc.NewFile-based tooling.
+//
+// main.Oracles, populated by Parse/Verify, holds only main's *direct*
+// dependencies -- parseDependencies never verifies the files it loads, so a
+// dependency's own Oracles is nil until something verifies it in turn. ToFiles
+// does that itself, calling pbparser.Verify (with the same p) on every
+// dependency file that imports further files of its own, so the whole graph
+// -- not just main's direct imports -- gets walked and converted.
+//
+// protodesc.NewFile resolves a file's Dependency entries by matching them
+// against the Name of files already registered with it, so dependencies
+// must both carry the same Name their dependent's Dependency list uses and
+// be registered before that dependent -- ToFiles walks the graph
+// depth-first, converting a file's dependencies before the file itself,
+// the same dependency-first ordering gen.topoSort produces for Run.
+func ToFiles(main *pbparser.ProtoFile, p pbparser.ImportModuleProvider) (*protoregistry.Files, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var ordered []*descriptorpb.FileDescriptorProto
+
+	var visit func(pf *pbparser.ProtoFile, importPath string) error
+	visit = func(pf *pbparser.ProtoFile, importPath string) error {
+		switch state[pf.PackageName] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("protodesc: dependency cycle detected at package %s", pf.PackageName)
+		}
+		state[pf.PackageName] = visiting
+
+		if pf.Oracles == nil && (len(pf.Dependencies) > 0 || len(pf.PublicDependencies) > 0) {
+			if err := pbparser.Verify(pf, p); err != nil {
+				return fmt.Errorf("protodesc: resolving dependencies of package %s: %w", pf.PackageName, err)
+			}
+		}
+
+		for pkg, orcl := range pf.Oracles {
+			if pkg == pf.PackageName {
+				continue
+			}
+			if err := visit(orcl.ProtoFile(), orcl.ImportPath()); err != nil {
+				return err
+			}
+		}
+
+		fdp, err := ToFileDescriptorProto(pf)
+		if err != nil {
+			return fmt.Errorf("protodesc: converting package %s: %w", pf.PackageName, err)
+		}
+		if importPath != "" {
+			fdp.Name = proto.String(importPath)
+		}
+		ordered = append(ordered, fdp)
+
+		state[pf.PackageName] = visited
+		return nil
+	}
+
+	if err := visit(main, ""); err != nil {
+		return nil, err
+	}
+
+	files := &protoregistry.Files{}
+	for _, fdp := range ordered {
+		fd, err := protodesc.NewFile(fdp, files)
+		if err != nil {
+			return nil, fmt.Errorf("protodesc: building reflect descriptor for package %s: %w", fdp.GetPackage(), err)
+		}
+		if err := files.RegisterFile(fd); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// fallbackFileName derives a deterministic, non-empty file path for a
+// package whose real import path isn't known (the root file passed to
+// ToFileDescriptorProto directly, or to ToFiles as main), since
+// descriptorpb requires every file to have a Name.
+func fallbackFileName(pkg string) string {
+	return strings.ReplaceAll(pkg, ".", "/") + ".proto"
+}
+
+func publicDependencyIndexes(pf *pbparser.ProtoFile) []int32 {
+	if len(pf.PublicDependencies) == 0 {
+		return nil
+	}
+	offset := int32(len(pf.Dependencies))
+	indexes := make([]int32, len(pf.PublicDependencies))
+	for i := range pf.PublicDependencies {
+		indexes[i] = offset + int32(i)
+	}
+	return indexes
+}
+
+func messageDescriptorProto(msg pbparser.MessageElement) (*descriptorpb.DescriptorProto, error) {
+	dp := &descriptorpb.DescriptorProto{
+		Name: proto.String(msg.Name),
+	}
+
+	for _, f := range msg.Fields {
+		fp, err := fieldDescriptorProto(msg, dp, f)
+		if err != nil {
+			return nil, fmt.Errorf("message %s: %w", msg.Name, err)
+		}
+		dp.Field = append(dp.Field, fp)
+	}
+
+	for i, oneof := range msg.OneOfs {
+		dp.OneofDecl = append(dp.OneofDecl, &descriptorpb.OneofDescriptorProto{
+			Name: proto.String(oneof.Name),
+		})
+		for _, f := range oneof.Fields {
+			fp, err := fieldDescriptorProto(msg, dp, f)
+			if err != nil {
+				return nil, fmt.Errorf("message %s: oneof %s: %w", msg.Name, oneof.Name, err)
+			}
+			fp.OneofIndex = proto.Int32(int32(i))
+			dp.Field = append(dp.Field, fp)
+		}
+	}
+
+	for _, nested := range msg.Messages {
+		np, err := messageDescriptorProto(nested)
+		if err != nil {
+			return nil, err
+		}
+		dp.NestedType = append(dp.NestedType, np)
+	}
+
+	for _, en := range msg.Enums {
+		ep, err := enumDescriptorProto(en)
+		if err != nil {
+			return nil, err
+		}
+		dp.EnumType = append(dp.EnumType, ep)
+	}
+
+	for _, rr := range msg.ReservedRanges {
+		dp.ReservedRange = append(dp.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{
+			Start: proto.Int32(int32(rr.Start)),
+			End:   proto.Int32(int32(rr.End) + 1), // descriptorpb ranges are end-exclusive
+		})
+	}
+	dp.ReservedName = append(dp.ReservedName, msg.ReservedNames...)
+
+	for _, er := range msg.ExtensionRanges {
+		dp.ExtensionRange = append(dp.ExtensionRange, &descriptorpb.DescriptorProto_ExtensionRange{
+			Start: proto.Int32(int32(er.Start)),
+			End:   proto.Int32(int32(er.End) + 1),
+		})
+	}
+
+	if opts := messageOptions(msg.Options); opts != nil {
+		dp.Options = opts
+	}
+
+	return dp, nil
+}
+
+// fieldDescriptorProto converts f, a field of msg, into its
+// FieldDescriptorProto. msg and dp (msg's own, in-progress DescriptorProto)
+// are threaded through only so that a map field can append its
+// compiler-synthesized entry message to dp.NestedType as a side effect.
+func fieldDescriptorProto(msg pbparser.MessageElement, dp *descriptorpb.DescriptorProto, f pbparser.FieldElement) (*descriptorpb.FieldDescriptorProto, error) {
+	fp := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(f.Name),
+		Number:   proto.Int32(int32(f.Tag)),
+		JsonName: proto.String(jsonName(f.Name)),
+	}
+
+	if f.Type.Category() == pbparser.MapDataTypeCategory {
+		mdt, ok := f.Type.(pbparser.MapDataType)
+		if !ok {
+			return nil, fmt.Errorf("field %s: map field's DataType is not a MapDataType", f.Name)
+		}
+		entryName, err := addMapEntryType(dp, mdt, f.Name)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		fp.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		fp.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		fp.TypeName = proto.String("." + msg.QualifiedName + "." + entryName)
+	} else {
+		fp.Label = fieldLabel(f)
+		typ, typeName, err := fieldType(f)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		fp.Type = typ.Enum()
+		if typeName != "" {
+			fp.TypeName = proto.String(typeName)
+		}
+	}
+
+	if f.DefaultValue != "" {
+		fp.DefaultValue = proto.String(f.DefaultValue)
+	}
+
+	if opts := fieldOptions(f.Options); opts != nil {
+		fp.Options = opts
+	}
+
+	return fp, nil
+}
+
+func fieldLabel(f pbparser.FieldElement) *descriptorpb.FieldDescriptorProto_Label {
+	switch f.Label {
+	case "repeated":
+		return descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	case "required":
+		return descriptorpb.FieldDescriptorProto_LABEL_REQUIRED.Enum()
+	default:
+		return descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	}
+}
+
+// fieldType maps a pbparser DataType to its descriptorpb type, returning
+// the type name for message/enum fields. Map fields are handled separately,
+// by addMapEntryType, since they need to synthesize a nested message rather
+// than just name one.
+func fieldType(f pbparser.FieldElement) (descriptorpb.FieldDescriptorProto_Type, string, error) {
+	return scalarOrNamedFieldType(f.Type)
+}
+
+func scalarOrNamedFieldType(dt pbparser.DataType) (descriptorpb.FieldDescriptorProto_Type, string, error) {
+	switch dt.Category() {
+	case pbparser.ScalarDataTypeCategory:
+		t, ok := scalarTypes[dt.Name()]
+		if !ok {
+			return 0, "", fmt.Errorf("unrecognized scalar type %q", dt.Name())
+		}
+		return t, "", nil
+	case pbparser.NamedDataTypeCategory:
+		return descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, dt.Name(), nil
+	case pbparser.EnumDataTypeCategory:
+		return descriptorpb.FieldDescriptorProto_TYPE_ENUM, dt.Name(), nil
+	default:
+		return 0, "", fmt.Errorf("unrecognized field type category for %q", dt.Name())
+	}
+}
+
+// addMapEntryType synthesizes the nested message protoc generates for a map
+// field -- on the wire, a map field is an implicitly-repeated message field
+// pointing at a "FooEntry" message with a MapEntry option and key (1) /
+// value (2) fields -- appends it to dp.NestedType, and returns its
+// unqualified name.
+func addMapEntryType(dp *descriptorpb.DescriptorProto, mdt pbparser.MapDataType, fieldName string) (string, error) {
+	keyType, keyTypeName, err := scalarOrNamedFieldType(mdt.KeyType())
+	if err != nil {
+		return "", fmt.Errorf("map key: %w", err)
+	}
+	valueType, valueTypeName, err := scalarOrNamedFieldType(mdt.ValueType())
+	if err != nil {
+		return "", fmt.Errorf("map value: %w", err)
+	}
+
+	keyField := &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String("key"),
+		Number: proto.Int32(1),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:   keyType.Enum(),
+	}
+	if keyTypeName != "" {
+		keyField.TypeName = proto.String(keyTypeName)
+	}
+
+	valueField := &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String("value"),
+		Number: proto.Int32(2),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:   valueType.Enum(),
+	}
+	if valueTypeName != "" {
+		valueField.TypeName = proto.String(valueTypeName)
+	}
+
+	entryName := mapEntryName(fieldName)
+	dp.NestedType = append(dp.NestedType, &descriptorpb.DescriptorProto{
+		Name:    proto.String(entryName),
+		Field:   []*descriptorpb.FieldDescriptorProto{keyField, valueField},
+		Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+	})
+	return entryName, nil
+}
+
+// mapEntryName derives the name protoc's compiler synthesizes for a map
+// field's entry message: the field's snake_case name converted to
+// PascalCase, with "Entry" appended, e.g. "my_map" -> "MyMapEntry".
+func mapEntryName(fieldName string) string {
+	var b []byte
+	upperNext := true
+	for i := 0; i < len(fieldName); i++ {
+		c := fieldName[i]
+		if c == '_' {
+			upperNext = true
+			continue
+		}
+		if upperNext && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upperNext = false
+		b = append(b, c)
+	}
+	return string(b) + "Entry"
+}
+
+var scalarTypes = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"double":   descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+	"float":    descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+	"int32":    descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	"int64":    descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	"uint32":   descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	"uint64":   descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+	"sint32":   descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+	"sint64":   descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+	"fixed32":  descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+	"fixed64":  descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+	"sfixed32": descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+	"sfixed64": descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+	"bool":     descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	"string":   descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	"bytes":    descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+}
+
+func enumDescriptorProto(en pbparser.EnumElement) (*descriptorpb.EnumDescriptorProto, error) {
+	ep := &descriptorpb.EnumDescriptorProto{
+		Name: proto.String(en.Name),
+	}
+	for _, enc := range en.EnumConstants {
+		evp := &descriptorpb.EnumValueDescriptorProto{
+			Name:   proto.String(enc.Name),
+			Number: proto.Int32(int32(enc.Tag)),
+		}
+		if opts := enumValueOptions(enc.Options); opts != nil {
+			evp.Options = opts
+		}
+		ep.Value = append(ep.Value, evp)
+	}
+	if opts := enumOptions(en.Options); opts != nil {
+		ep.Options = opts
+	}
+	return ep, nil
+}
+
+func serviceDescriptorProto(svc pbparser.ServiceElement) (*descriptorpb.ServiceDescriptorProto, error) {
+	sp := &descriptorpb.ServiceDescriptorProto{
+		Name: proto.String(svc.Name),
+	}
+	for _, rpc := range svc.RPCs {
+		mp := &descriptorpb.MethodDescriptorProto{
+			Name:            proto.String(rpc.Name),
+			InputType:       proto.String(rpc.RequestType.Name()),
+			OutputType:      proto.String(rpc.ResponseType.Name()),
+			ClientStreaming: proto.Bool(rpc.StreamingRequest),
+			ServerStreaming: proto.Bool(rpc.StreamingResponse),
+		}
+		if opts := methodOptions(rpc.Options); opts != nil {
+			mp.Options = opts
+		}
+		sp.Method = append(sp.Method, mp)
+	}
+	if opts := serviceOptions(svc.Options); opts != nil {
+		sp.Options = opts
+	}
+	return sp, nil
+}
+
+// jsonName mirrors protoc's default JSON name derivation: snake_case field
+// names are converted to lowerCamelCase.
+func jsonName(fieldName string) string {
+	var b []byte
+	upperNext := false
+	for i := 0; i < len(fieldName); i++ {
+		c := fieldName[i]
+		if c == '_' {
+			upperNext = true
+			continue
+		}
+		if upperNext && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upperNext = false
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+// The option* helpers below translate the handful of well-known,
+// non-extension options the parser exposes as plain Name/Value pairs into
+// their typed descriptorpb.*Options field. Custom options (extensions of
+// these messages) are left to the option-resolution pass in pbparser's
+// linker, which attaches a typed, resolved value callers can fold in
+// separately via proto.SetExtension.
+
+func fileOptions(opts []pbparser.OptionElement) *descriptorpb.FileOptions {
+	fo := &descriptorpb.FileOptions{}
+	var set bool
+	for _, o := range opts {
+		switch o.Name {
+		case "java_package":
+			fo.JavaPackage, set = proto.String(o.Value), true
+		case "java_outer_classname":
+			fo.JavaOuterClassname, set = proto.String(o.Value), true
+		case "go_package":
+			fo.GoPackage, set = proto.String(o.Value), true
+		case "deprecated":
+			fo.Deprecated, set = proto.Bool(o.Value == "true"), true
+		}
+	}
+	if !set {
+		return nil
+	}
+	return fo
+}
+
+func messageOptions(opts []pbparser.OptionElement) *descriptorpb.MessageOptions {
+	mo := &descriptorpb.MessageOptions{}
+	var set bool
+	for _, o := range opts {
+		if o.Name == "deprecated" {
+			mo.Deprecated, set = proto.Bool(o.Value == "true"), true
+		}
+	}
+	if !set {
+		return nil
+	}
+	return mo
+}
+
+func fieldOptions(opts []pbparser.OptionElement) *descriptorpb.FieldOptions {
+	fo := &descriptorpb.FieldOptions{}
+	var set bool
+	for _, o := range opts {
+		switch o.Name {
+		case "deprecated":
+			fo.Deprecated, set = proto.Bool(o.Value == "true"), true
+		case "packed":
+			fo.Packed, set = proto.Bool(o.Value == "true"), true
+		}
+	}
+	if !set {
+		return nil
+	}
+	return fo
+}
+
+func enumOptions(opts []pbparser.OptionElement) *descriptorpb.EnumOptions {
+	eo := &descriptorpb.EnumOptions{}
+	var set bool
+	for _, o := range opts {
+		switch o.Name {
+		case "allow_alias":
+			eo.AllowAlias, set = proto.Bool(o.Value == "true"), true
+		case "deprecated":
+			eo.Deprecated, set = proto.Bool(o.Value == "true"), true
+		}
+	}
+	if !set {
+		return nil
+	}
+	return eo
+}
+
+func enumValueOptions(opts []pbparser.OptionElement) *descriptorpb.EnumValueOptions {
+	vo := &descriptorpb.EnumValueOptions{}
+	var set bool
+	for _, o := range opts {
+		if o.Name == "deprecated" {
+			vo.Deprecated, set = proto.Bool(o.Value == "true"), true
+		}
+	}
+	if !set {
+		return nil
+	}
+	return vo
+}
+
+func serviceOptions(opts []pbparser.OptionElement) *descriptorpb.ServiceOptions {
+	so := &descriptorpb.ServiceOptions{}
+	var set bool
+	for _, o := range opts {
+		if o.Name == "deprecated" {
+			so.Deprecated, set = proto.Bool(o.Value == "true"), true
+		}
+	}
+	if !set {
+		return nil
+	}
+	return so
+}
+
+func methodOptions(opts []pbparser.OptionElement) *descriptorpb.MethodOptions {
+	mo := &descriptorpb.MethodOptions{}
+	var set bool
+	for _, o := range opts {
+		if o.Name == "deprecated" {
+			mo.Deprecated, set = proto.Bool(o.Value == "true"), true
+		}
+	}
+	if !set {
+		return nil
+	}
+	return mo
+}
@@ -4,13 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"strings"
-	"unicode"
+
+	"github.com/gingerbus/pbparser/linker"
 )
 
 type ProtoFileOracle struct {
-	pf      *ProtoFile
-	msgmap  map[string]bool
-	enummap map[string]bool
+	pf         *ProtoFile
+	msgmap     map[string]bool
+	enummap    map[string]bool
+	importPath string
 }
 
 func (p *ProtoFileOracle) HasEnum(enum string) bool {
@@ -18,6 +20,29 @@ func (p *ProtoFileOracle) HasEnum(enum string) bool {
 	return ok
 }
 
+// ProtoFile returns the parsed model this oracle was built from, so that
+// external packages (e.g. protodesc) can walk a file's dependencies via
+// ProtoFile.Oracles without reaching into unexported fields.
+func (p *ProtoFileOracle) ProtoFile() *ProtoFile {
+	return p.pf
+}
+
+// ImportPath returns the string this oracle's file was imported by (the
+// literal argument passed to ImportModuleProvider.Provide), or "" for the
+// main file's own oracle, which nothing imports. External packages (e.g.
+// protodesc) use this to give a dependency file the same identity its
+// importer's Dependency list references it by.
+func (p *ProtoFileOracle) ImportPath() string {
+	return p.importPath
+}
+
+// Verify runs the same validation and linking pass Parse runs internally,
+// exported so that external tooling (e.g. pbparser/gen) can verify and link
+// a ProtoFile it already has in hand without re-parsing it.
+func Verify(pf *ProtoFile, p ImportModuleProvider) error {
+	return verify(pf, p)
+}
+
 func verify(pf *ProtoFile, p ImportModuleProvider) error {
 	// validate syntax
 	if err := validateSyntax(pf); err != nil {
@@ -57,40 +82,42 @@ func verify(pf *ProtoFile, p ImportModuleProvider) error {
 		pf.Oracles[pf.PackageName] = orcl
 	}
 
+	// build the descriptorPool: every message, enum and extension field
+	// declared across the main file and its direct and public dependencies
+	// (the files imports of those dependencies pull in are not included),
+	// keyed by fully-qualified name, so that type references can be
+	// resolved in a single pass
+	linkerPool, err := buildSymbolPool(pf)
+	if err != nil {
+		return err
+	}
+
 	// collate the dependency package names...
-	packageNames := getDependencyPackageNames(pf.PackageName, pf.Oracles)
+	packageNames := linkerPool.Packages()
 
 	// check if imported packages are in use
 	if err := areImportedPackagesUsed(pf, packageNames); err != nil {
 		return err
 	}
 
-	// validate if the NamedDataType fields of messages (deep ones as well)
-	// are all defined in the model; either the main model or in dependencies
+	// resolve the NamedDataType fields of messages (deep ones as well)
+	// against the linker's symbol pool, rewriting each one to its
+	// canonical fully-qualified name and correcting its Category() when it
+	// turns out to be an enum rather than a message
 	fields := []fd{}
 	findFieldsToValidate(pf.Messages, &fields)
 	for _, f := range fields {
-		if err := validateFieldDataTypes(
-			pf.PackageName, f, pf.Messages, pf.Enums, pf.Oracles, packageNames); err != nil {
+		if err := resolveFieldDataType(linkerPool, f); err != nil {
 			return err
 		}
 	}
 
-	// validate if each rpc request/response type is defined in the model;
-	// either the main model or in dependencies
-	for _, s := range pf.Services {
-		for _, rpc := range s.RPCs {
-			err := validateRPCDataType(
-				pf.PackageName, s.Name, rpc.Name, rpc.RequestType, pf.Messages, pf.Oracles,
-				packageNames)
-			if err != nil {
-				return err
-			}
-
-			err = validateRPCDataType(
-				pf.PackageName, s.Name, rpc.Name, rpc.ResponseType, pf.Messages, pf.Oracles,
-				packageNames)
-			if err != nil {
+	// resolve each rpc request/response type against the linker's symbol
+	// pool, requiring it to land on a message (not an enum)
+	for si := range pf.Services {
+		s := &pf.Services[si]
+		for ri := range s.RPCs {
+			if err := resolveRPCDataType(linkerPool, pf.PackageName, s.Name, &s.RPCs[ri]); err != nil {
 				return err
 			}
 		}
@@ -98,8 +125,7 @@ func verify(pf *ProtoFile, p ImportModuleProvider) error {
 
 	// validate that message and enum names are unique in the package as well as
 	// at the nested msg level (howsoever deep)
-	err := validateUniqueMessageEnumNames("package "+pf.PackageName, pf.Enums, pf.Messages)
-	if err != nil {
+	if err := validateUniqueMessageEnumNames("package "+pf.PackageName, pf.Enums, pf.Messages); err != nil {
 		return err
 	}
 
@@ -127,6 +153,35 @@ func verify(pf *ProtoFile, p ImportModuleProvider) error {
 		}
 	}
 
+	// validate field tags, extension ranges, oneofs and map fields for every
+	// message (howsoever deep)
+	for _, msg := range pf.Messages {
+		if err := validateMessageStructure(msg, pf.Syntax); err != nil {
+			return err
+		}
+	}
+
+	// validate that no enum constant reuses a reserved tag or name, for
+	// every enum in the package as well as nested enums (howsoever deep)
+	for _, en := range pf.Enums {
+		if err := validateEnumReservations(en); err != nil {
+			return err
+		}
+	}
+	for _, msg := range pf.Messages {
+		if err := validateEnumReservationsInMessage(msg); err != nil {
+			return err
+		}
+	}
+
+	// resolve every custom option (an option whose name is a parenthesized,
+	// dotted extension field reference) against the extension fields in the
+	// descriptor pool, attaching the resolved extend field and a typed
+	// value to each one
+	if err := resolveOptions(pf, linkerPool); err != nil {
+		return err
+	}
+
 	// TODO: add more checks here if needed
 
 	return nil
@@ -215,8 +270,7 @@ func areImportedPackagesUsed(
 func checkImportedPackageUsage(msgs []MessageElement, pkg string, packageNames []string) bool {
 	for _, msg := range msgs {
 		for _, f := range msg.Fields {
-			if f.Type.Category() == NamedDataTypeCategory &&
-				usesPackage(f.Type.Name(), pkg, packageNames) {
+			if fieldUsesPackage(f, pkg, packageNames) {
 				return true
 			}
 		}
@@ -229,14 +283,26 @@ func checkImportedPackageUsage(msgs []MessageElement, pkg string, packageNames [
 	return false
 }
 
-func usesPackage(s string, pkg string, packageNames []string) bool {
-	if strings.ContainsRune(s, '.') {
-		inSamePkg, pkgName := isDatatypeInSamePackage(s, packageNames)
-		if !inSamePkg && pkg == pkgName {
-			return true
-		}
+// fieldUsesPackage reports whether f references pkg, either directly (a
+// named message/enum field) or, for a map field, through its value type --
+// a map's key is always scalar and never references an imported package.
+func fieldUsesPackage(f FieldElement, pkg string, packageNames []string) bool {
+	switch f.Type.Category() {
+	case NamedDataTypeCategory:
+		return usesPackage(f.Type.Name(), pkg, packageNames)
+	case MapDataTypeCategory:
+		mdt, ok := f.Type.(MapDataType)
+		if !ok {
+			return false
+		}
+		return usesPackage(mdt.ValueType().Name(), pkg, packageNames)
+	default:
+		return false
 	}
-	return false
+}
+
+func usesPackage(s string, pkg string, packageNames []string) bool {
+	return strings.HasPrefix(s, pkg+".")
 }
 
 func validateUniqueMessageEnumNames(
@@ -334,17 +400,6 @@ func validateSyntax(pf *ProtoFile) error {
 	return nil
 }
 
-func getDependencyPackageNames(mainPkgName string, m map[string]ProtoFileOracle) []string {
-	var keys []string
-	for k := range m {
-		if k == mainPkgName {
-			continue
-		}
-		keys = append(keys, k)
-	}
-	return keys
-}
-
 func makeQNameLookup(dpf *ProtoFile) (map[string]bool, map[string]bool) {
 	msgmap := make(map[string]bool)
 	enummap := make(map[string]bool)
@@ -369,16 +424,19 @@ func gatherNestedQNames(parentmsg MessageElement, msgmap map[string]bool, enumma
 }
 
 type fd struct {
-	name     string
-	category string
-	msg      MessageElement
+	name  string
+	scope string
+	field *FieldElement
 }
 
 func findFieldsToValidate(msgs []MessageElement, fields *[]fd) {
-	for _, msg := range msgs {
-		for _, f := range msg.Fields {
-			if f.Type.Category() == NamedDataTypeCategory {
-				*fields = append(*fields, fd{name: f.Name, category: f.Type.Name(), msg: msg})
+	for i := range msgs {
+		msg := &msgs[i]
+		for j := range msg.Fields {
+			field := &msg.Fields[j]
+			switch field.Type.Category() {
+			case NamedDataTypeCategory, MapDataTypeCategory:
+				*fields = append(*fields, fd{name: field.Name, scope: msg.QualifiedName, field: field})
 			}
 		}
 		if len(msg.Messages) > 0 {
@@ -387,154 +445,331 @@ func findFieldsToValidate(msgs []MessageElement, fields *[]fd) {
 	}
 }
 
-func validateFieldDataTypes(
-	mainpkg string,
-	f fd,
-	msgs []MessageElement,
-	enums []EnumElement,
-	m map[string]ProtoFileOracle,
-	packageNames []string,
-) error {
-	var found bool
-	if strings.ContainsRune(f.category, '.') {
-		inSamePkg, pkgName := isDatatypeInSamePackage(f.category, packageNames)
-		if inSamePkg {
-			orcl := m[mainpkg]
-
-			var msgMatchTerm, enumMatchTerm string
-			if !strings.HasPrefix(f.category, mainpkg+".") {
-				msgMatchTerm = mainpkg + "." + f.category
-				enumMatchTerm = mainpkg + "." + f.category
-			} else {
-				msgMatchTerm = f.category
-				enumMatchTerm = f.category
-			}
+// buildSymbolPool aggregates every message, enum and extension field
+// declared across the main file and its direct and public dependencies
+// (the entries of pf.Oracles) into a single linker.Pool, keyed by
+// fully-qualified name, so that NamedDataType references can be resolved
+// in one pass instead of the old dotted-vs-undotted,
+// same-package-vs-dependency heuristics. Files imported only by a
+// dependency are not part of pf.Oracles and are not inserted.
+func buildSymbolPool(pf *ProtoFile) (*linker.Pool, error) {
+	pool := linker.NewPool(pf.PackageName)
+	for pkg, orcl := range pf.Oracles {
+		pool.RegisterPackage(pkg)
+		src := orcl.pf
+		if pkg == pf.PackageName {
+			// pf holds the main file's declarations merged with those of
+			// any dependency sharing its package
+			src = pf
+		}
+		if err := insertMessagesAndEnums(pool, src.Messages, src.Enums); err != nil {
+			return nil, err
+		}
+		if err := insertExtensions(pool, pkg, src); err != nil {
+			return nil, err
+		}
+	}
+	return pool, nil
+}
 
-			// Check against normal and nested messages & enums in same package
-			found = orcl.msgmap[msgMatchTerm]
-			if !found {
-				found = orcl.enummap[enumMatchTerm]
-			}
-		} else {
-			orcl := m[pkgName]
-			// Check against normal and nested messages & enums in dependency package
-			found = orcl.msgmap[f.category]
-			if !found {
-				found = orcl.enummap[f.category]
-			}
+func insertMessagesAndEnums(pool *linker.Pool, msgs []MessageElement, enums []EnumElement) error {
+	for _, msg := range msgs {
+		if err := pool.Insert(msg.QualifiedName, linker.MessageSymbol); err != nil {
+			return err
 		}
-	} else {
-		// Check any nested messages and nested enums in the same message which has the field
-		found = checkMsgOrEnumName(f.category, f.msg.Messages, f.msg.Enums)
-		// If not a nested message or enum, then just check first class
-		// messages & enums in the package
-		if !found {
-			found = checkMsgOrEnumName(f.category, msgs, enums)
+		if err := insertMessagesAndEnums(pool, msg.Messages, msg.Enums); err != nil {
+			return err
 		}
 	}
-	if !found {
-		msg := fmt.Sprintf("Datatype: '%v' referenced in field: '%v' is not defined",
-			f.category, f.name)
-		return errors.New(msg)
+	for _, en := range enums {
+		if err := pool.Insert(en.QualifiedName, linker.EnumSymbol); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func validateRPCDataType(
-	mainpkg string,
-	service string,
-	rpc string,
-	datatype NamedDataType,
-	msgs []MessageElement,
-	m map[string]ProtoFileOracle,
-	packageNames []string,
-) error {
-	var found bool
-	if strings.ContainsRune(datatype.Name(), '.') {
-		inSamePkg, pkgName := isDatatypeInSamePackage(datatype.Name(), packageNames)
-		if inSamePkg {
-			// Check against normal as well as nested types in same package
-			orcl := m[mainpkg]
-			found = orcl.msgmap[mainpkg+"."+datatype.Name()]
-		} else {
-			orcl := m[pkgName]
-			// Check against normal and nested messages & enums in dependency package
-			found = orcl.msgmap[datatype.Name()]
-		}
+// resolveFieldDataType resolves a field's NamedDataType reference against
+// the pool by walking outward from the scope it was declared in (the
+// message's own fully-qualified name), exactly as protoc resolves a
+// message/enum reference: try "<scope>.<name>", then "<scope's
+// parent>.<name>", and so on up to the root. On success the field's type
+// is rewritten to the symbol's canonical fully-qualified (leading-dot)
+// name, and its Category() is corrected to an enum reference if that's
+// what the name actually resolved to -- something the parser alone can't
+// know, since an undotted or same-package reference is ambiguous between
+// a message and an enum until the whole dependency graph is linked.
+func resolveFieldDataType(pool *linker.Pool, f fd) error {
+	if f.field.Type.Category() == MapDataTypeCategory {
+		return resolveMapValueDataType(pool, f)
+	}
+
+	name := f.field.Type.Name()
+	sym, ok := pool.Resolve(f.scope, name)
+	if !ok {
+		msg := fmt.Sprintf("Datatype: '%v' referenced in field: '%v' is not defined", name, f.name)
+		return errors.New(msg)
+	}
+	if sym.Kind == linker.EnumSymbol {
+		f.field.Type = EnumDataType(sym.FullyQualifiedName)
 	} else {
-		found = checkMsgName(datatype.Name(), msgs)
+		f.field.Type = NamedDataType(sym.FullyQualifiedName)
 	}
-	if !found {
-		msg := fmt.Sprintf("Datatype: '%v' referenced in RPC: '%v' of Service: '%v'"+
-			" is not defined OR is not a message type", datatype.Name(), rpc, service)
+	return nil
+}
+
+// resolveMapValueDataType resolves a map field's value type the same way
+// resolveFieldDataType resolves a plain field reference, for the case where
+// that value type is itself a forward message/enum reference. Map keys are
+// always a scalar type and never need resolving.
+func resolveMapValueDataType(pool *linker.Pool, f fd) error {
+	mdt, ok := f.field.Type.(MapDataType)
+	if !ok || mdt.ValueType().Category() != NamedDataTypeCategory {
+		return nil
+	}
+
+	name := mdt.ValueType().Name()
+	sym, ok := pool.Resolve(f.scope, name)
+	if !ok {
+		msg := fmt.Sprintf("Datatype: '%v' referenced as the value type of map field: '%v' is not defined", name, f.name)
 		return errors.New(msg)
 	}
+
+	var resolved DataType
+	if sym.Kind == linker.EnumSymbol {
+		resolved = EnumDataType(sym.FullyQualifiedName)
+	} else {
+		resolved = NamedDataType(sym.FullyQualifiedName)
+	}
+	f.field.Type = NewMapDataType(mdt.KeyType(), resolved)
 	return nil
 }
 
-// Gets the most-specific package name for the given type name.
-//
-// In order to support nested-message imports like `foo.bar.BazMessage.InnerMessage`
-// the "most specific" check uses the last package segment that is
-// not uppercased as the last package segment. This aligns with
-// naming conventions laid out by Google and most common usage.
-func getPackageName(datatypeName string) string {
-	parts := strings.Split(datatypeName, ".")
-	if len(parts) == 1 {
-		return "" // no package name
+// resolveRPCDataType resolves an RPC's request/response type against the
+// pool, scoped to the file's own package (RPC types, unlike field types,
+// are never resolved relative to a nested message). It is an error for
+// the name to resolve to anything other than a message.
+func resolveRPCDataType(pool *linker.Pool, pkg string, service string, rpc *RPCElement) error {
+	for _, ref := range []*NamedDataType{&rpc.RequestType, &rpc.ResponseType} {
+		sym, ok := pool.Resolve(pkg, ref.Name())
+		if !ok || sym.Kind != linker.MessageSymbol {
+			msg := fmt.Sprintf("Datatype: '%v' referenced in RPC: '%v' of Service: '%v'"+
+				" is not defined OR is not a message type", ref.Name(), rpc.Name, service)
+			return errors.New(msg)
+		}
+		*ref = NamedDataType(sym.FullyQualifiedName)
 	}
+	return nil
+}
 
-	offset := 0
-	for i, p := range parts {
-		if unicode.IsUpper(rune(p[0])) {
-			break
-		}
+// Field tags must fall within protobuf's valid range, excluding the block
+// reserved for internal use by the protobuf implementation itself.
+const (
+	minFieldTag       = 1
+	maxFieldTag       = 536870911
+	reservedTagsStart = 19000
+	reservedTagsEnd   = 19999
+)
 
-		offset += len(p)
-		if i > 0 {
-			offset += 1 // also account for the '.'
+// validateMessageStructure runs the reserved/extension/oneof/map checks
+// desc_validate performs for a single message, then recurses into its
+// nested messages (howsoever deep), the same way validateEnumConstantsInMessage does.
+func validateMessageStructure(msg MessageElement, syntax string) error {
+	if err := validateFieldTags(msg); err != nil {
+		return err
+	}
+	if err := validateExtensionRanges(msg, syntax); err != nil {
+		return err
+	}
+	if err := validateOneofs(msg); err != nil {
+		return err
+	}
+	if err := validateMapFields(msg); err != nil {
+		return err
+	}
+	for _, nested := range msg.Messages {
+		if err := validateMessageStructure(nested, syntax); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	return datatypeName[:offset]
+// allFieldsInMessage returns every field directly on msg plus every field
+// nested inside one of its oneofs -- the full set that shares a single tag
+// namespace.
+func allFieldsInMessage(msg MessageElement) []FieldElement {
+	fields := append([]FieldElement{}, msg.Fields...)
+	for _, o := range msg.OneOfs {
+		fields = append(fields, o.Fields...)
+	}
+	return fields
 }
 
-func isDatatypeInSamePackage(datatypeName string, packageNames []string) (bool, string) {
-	dtPkg := getPackageName(datatypeName)
-	if len(dtPkg) == 0 {
-		return true, ""
+// validateFieldTags checks that no two fields in msg (oneof members
+// included, since they share the same tag namespace) reuse a tag number,
+// that every tag falls in protobuf's valid range and outside the block
+// reserved for internal use, and that no tag or field name collides with
+// one of msg's own reserved ranges/names.
+func validateFieldTags(msg MessageElement) error {
+	seen := make(map[int]bool)
+	for _, f := range allFieldsInMessage(msg) {
+		if f.Tag < minFieldTag || f.Tag > maxFieldTag {
+			return fmt.Errorf("field %s in message %s: tag %d is out of range (must be between %d and %d)",
+				f.Name, msg.Name, f.Tag, minFieldTag, maxFieldTag)
+		}
+		if f.Tag >= reservedTagsStart && f.Tag <= reservedTagsEnd {
+			return fmt.Errorf("field %s in message %s: tag %d falls in the reserved range %d-%d",
+				f.Name, msg.Name, f.Tag, reservedTagsStart, reservedTagsEnd)
+		}
+		if seen[f.Tag] {
+			return fmt.Errorf("field %s in message %s: tag %d is already in use by another field",
+				f.Name, msg.Name, f.Tag)
+		}
+		seen[f.Tag] = true
+
+		for _, rr := range msg.ReservedRanges {
+			if f.Tag >= rr.Start && f.Tag <= rr.End {
+				return fmt.Errorf("field %s in message %s: tag %d is reserved (range %d-%d)",
+					f.Name, msg.Name, f.Tag, rr.Start, rr.End)
+			}
+		}
+		for _, rn := range msg.ReservedNames {
+			if rn == f.Name {
+				return fmt.Errorf("field %s in message %s: name is reserved", f.Name, msg.Name)
+			}
+		}
 	}
-	for _, pkg := range packageNames {
-		if pkg == dtPkg {
-			return false, pkg
+	return nil
+}
+
+// validateExtensionRanges checks that msg's extension ranges don't overlap
+// each other or any of its fields' tags, and that a proto3 message only
+// declares extension ranges when it is itself one of the well-known
+// google.protobuf.*Options extendees.
+func validateExtensionRanges(msg MessageElement, syntax string) error {
+	for i, er := range msg.ExtensionRanges {
+		if er.Start < minFieldTag || er.End > maxFieldTag || er.Start > er.End {
+			return fmt.Errorf("message %s: extension range %d-%d is invalid", msg.Name, er.Start, er.End)
+		}
+		for j, other := range msg.ExtensionRanges {
+			if i != j && er.Start <= other.End && other.Start <= er.End {
+				return fmt.Errorf("message %s: extension range %d-%d overlaps extension range %d-%d",
+					msg.Name, er.Start, er.End, other.Start, other.End)
+			}
+		}
+		for _, f := range allFieldsInMessage(msg) {
+			if f.Tag >= er.Start && f.Tag <= er.End {
+				return fmt.Errorf("message %s: extension range %d-%d overlaps field %s (tag %d)",
+					msg.Name, er.Start, er.End, f.Name, f.Tag)
+			}
 		}
 	}
-	return true, ""
+
+	if syntax == "proto3" && len(msg.ExtensionRanges) > 0 && !isOptionsExtendee(msg) {
+		return fmt.Errorf("message %s: proto3 messages may not declare extension ranges", msg.Name)
+	}
+	return nil
 }
 
-func checkMsgOrEnumName(s string, msgs []MessageElement, enums []EnumElement) bool {
-	if checkMsgName(s, msgs) {
+// isOptionsExtendee reports whether msg is one of the well-known
+// google.protobuf.*Options messages, the only messages proto3 is allowed
+// to declare extension ranges for (to support custom options).
+func isOptionsExtendee(msg MessageElement) bool {
+	switch msg.QualifiedName {
+	case "google.protobuf.FileOptions",
+		"google.protobuf.MessageOptions",
+		"google.protobuf.FieldOptions",
+		"google.protobuf.OneofOptions",
+		"google.protobuf.EnumOptions",
+		"google.protobuf.EnumValueOptions",
+		"google.protobuf.ServiceOptions",
+		"google.protobuf.MethodOptions":
 		return true
+	default:
+		return false
 	}
-	return checkEnumName(s, enums)
 }
 
-func checkMsgName(m string, msgs []MessageElement) bool {
-	for _, msg := range msgs {
-		if msg.Name == m {
-			return true
+// validateOneofs checks that every oneof in msg declares at least one
+// field, and that none of its fields are repeated or maps -- both are
+// disallowed inside a oneof.
+func validateOneofs(msg MessageElement) error {
+	for _, o := range msg.OneOfs {
+		if len(o.Fields) == 0 {
+			return fmt.Errorf("oneof %s in message %s must contain at least one field", o.Name, msg.Name)
+		}
+		for _, f := range o.Fields {
+			if f.Label == "repeated" {
+				return fmt.Errorf("oneof %s in message %s: field %s must not be repeated", o.Name, msg.Name, f.Name)
+			}
+			if f.Type.Category() == MapDataTypeCategory {
+				return fmt.Errorf("oneof %s in message %s: field %s must not be a map", o.Name, msg.Name, f.Name)
+			}
 		}
 	}
-	return false
+	return nil
 }
 
-func checkEnumName(s string, enums []EnumElement) bool {
-	for _, en := range enums {
-		if en.Name == s {
-			return true
+// validateMapFields checks that map fields aren't explicitly repeated
+// (maps are implicitly repeated on the wire) and that their key type is
+// one of the integral, string or bool types protobuf allows as a map key.
+func validateMapFields(msg MessageElement) error {
+	for _, f := range msg.Fields {
+		if f.Type.Category() != MapDataTypeCategory {
+			continue
+		}
+		if f.Label == "repeated" {
+			return fmt.Errorf("map field %s in message %s must not be declared repeated", f.Name, msg.Name)
+		}
+		mdt, ok := f.Type.(MapDataType)
+		if !ok {
+			continue
+		}
+		switch mdt.KeyType().Name() {
+		case "int32", "int64", "uint32", "uint64", "sint32", "sint64",
+			"fixed32", "fixed64", "sfixed32", "sfixed64", "bool", "string":
+		default:
+			return fmt.Errorf("map field %s in message %s: key type %q is not allowed; "+
+				"must be an integral, string or bool type", f.Name, msg.Name, mdt.KeyType().Name())
 		}
 	}
-	return false
+	return nil
+}
+
+// validateEnumReservations checks that no enum constant in en reuses one of
+// en's reserved tags or names.
+func validateEnumReservations(en EnumElement) error {
+	for _, enc := range en.EnumConstants {
+		for _, rr := range en.ReservedRanges {
+			if enc.Tag >= rr.Start && enc.Tag <= rr.End {
+				return fmt.Errorf("enum constant %s in enum %s: tag %d is reserved (range %d-%d)",
+					enc.Name, en.Name, enc.Tag, rr.Start, rr.End)
+			}
+		}
+		for _, rn := range en.ReservedNames {
+			if rn == enc.Name {
+				return fmt.Errorf("enum constant %s in enum %s: name is reserved", enc.Name, en.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateEnumReservationsInMessage runs validateEnumReservations over
+// every enum nested in msg (howsoever deep).
+func validateEnumReservationsInMessage(msg MessageElement) error {
+	for _, en := range msg.Enums {
+		if err := validateEnumReservations(en); err != nil {
+			return err
+		}
+	}
+	for _, nested := range msg.Messages {
+		if err := validateEnumReservationsInMessage(nested); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func parseDependencies(
@@ -566,7 +801,7 @@ func parseDependencies(
 			return err
 		}
 
-		orcl := ProtoFileOracle{pf: &dpf}
+		orcl := ProtoFileOracle{pf: &dpf, importPath: d}
 		orcl.msgmap, orcl.enummap = makeQNameLookup(&dpf)
 
 		if _, found := m[dpf.PackageName]; found {